@@ -0,0 +1,158 @@
+// Package ports allocates server ports for TCP tunnels from a fixed range.
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrExhausted matches, via errors.Is, the *ExhaustedError returned by
+// Allocate when every port in the range is in use.
+var ErrExhausted = errors.New("ports: range exhausted")
+
+// DefaultRetryAfter is the retry hint used when Allocator.RetryAfter is
+// zero.
+const DefaultRetryAfter = 30 * time.Second
+
+// ExhaustedError is returned by Allocate when every port in the range is in
+// use. Registration should report it to the client as a retryable
+// condition, passing RetryAfter on as the time to wait before trying again.
+type ExhaustedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("ports: range exhausted, retry after %v", e.RetryAfter)
+}
+
+// Is reports whether target is ErrExhausted.
+func (e *ExhaustedError) Is(target error) bool {
+	return target == ErrExhausted
+}
+
+// Lease is an allocated port. The generation ties the lease to one
+// allocation, so a stale holder cannot release a port that has since been
+// handed to someone else.
+type Lease struct {
+	Port int
+	gen  uint64
+}
+
+// Allocator hands out ports from [min, max]. Ports that have never been
+// used are handed out first. Once the range has been used up, released
+// ports are reused oldest-first. This keeps a just-released port out of
+// circulation for as long as possible, while stale visitors may still be
+// dialing it.
+type Allocator struct {
+	// OnRelease, if set, is called after a port is released, outside the
+	// allocator's lock. It is where callers drop routing entries and proxy
+	// routes tied to the port. Set it before the allocator is shared.
+	OnRelease func(port int)
+
+	// RetryAfter is the hint put in an *ExhaustedError. Zero means
+	// DefaultRetryAfter. Like OnRelease, set it before the allocator is
+	// shared.
+	RetryAfter time.Duration
+
+	mu     sync.Mutex
+	min    int
+	max    int
+	next   int   // lowest port never handed out
+	free   []int // released ports, oldest first
+	gen    uint64
+	active map[int]uint64 // port -> generation of its lease
+
+	exhausted uint64 // Allocate calls that returned *ExhaustedError
+}
+
+// Stats is a snapshot of allocator usage, meant to be exported as metrics.
+type Stats struct {
+	Size      int    // ports in the range
+	InUse     int    // ports currently allocated
+	Exhausted uint64 // Allocate calls that failed with *ExhaustedError
+}
+
+// NewAllocator returns an allocator for the inclusive range [min, max].
+func NewAllocator(min, max int) (*Allocator, error) {
+	if min < 1 || max > 65535 || min > max {
+		return nil, fmt.Errorf("ports: invalid range %d-%d", min, max)
+	}
+	return &Allocator{
+		min:    min,
+		max:    max,
+		next:   min,
+		active: make(map[int]uint64),
+	}, nil
+}
+
+// Allocate leases an unused port, or returns an *ExhaustedError.
+func (a *Allocator) Allocate() (Lease, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var port int
+	switch {
+	case a.next <= a.max:
+		port = a.next
+		a.next++
+	case len(a.free) > 0:
+		port = a.free[0]
+		a.free = a.free[1:]
+	default:
+		a.exhausted++
+		retry := a.RetryAfter
+		if retry == 0 {
+			retry = DefaultRetryAfter
+		}
+		return Lease{}, &ExhaustedError{RetryAfter: retry}
+	}
+	a.gen++
+	a.active[port] = a.gen
+	return Lease{Port: port, gen: a.gen}, nil
+}
+
+// Release returns the leased port to the pool. It reports whether the
+// lease was still current; releasing twice, or releasing a lease whose port
+// has since been allocated again, is a no-op.
+func (a *Allocator) Release(l Lease) bool {
+	a.mu.Lock()
+	if gen, ok := a.active[l.Port]; !ok || gen != l.gen {
+		a.mu.Unlock()
+		return false
+	}
+	delete(a.active, l.Port)
+	a.free = append(a.free, l.Port)
+	a.mu.Unlock()
+
+	if a.OnRelease != nil {
+		a.OnRelease(l.Port)
+	}
+	return true
+}
+
+// InUse reports whether port is currently allocated.
+func (a *Allocator) InUse(port int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.active[port]
+	return ok
+}
+
+// Len returns the number of allocated ports.
+func (a *Allocator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.active)
+}
+
+// Stats returns a snapshot of the allocator's usage.
+func (a *Allocator) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return Stats{
+		Size:      a.max - a.min + 1,
+		InUse:     len(a.active),
+		Exhausted: a.exhausted,
+	}
+}
@@ -0,0 +1,151 @@
+package ports
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestAllocator(t *testing.T, min, max int) *Allocator {
+	t.Helper()
+	a, err := NewAllocator(min, max)
+	if err != nil {
+		t.Fatalf("NewAllocator(%d, %d): %v", min, max, err)
+	}
+	return a
+}
+
+func mustAllocate(t *testing.T, a *Allocator) Lease {
+	t.Helper()
+	l, err := a.Allocate()
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	return l
+}
+
+func TestNewAllocatorRange(t *testing.T) {
+	for _, r := range [][2]int{{0, 10}, {10, 9}, {1, 65536}} {
+		if _, err := NewAllocator(r[0], r[1]); err == nil {
+			t.Errorf("NewAllocator(%d, %d) succeeded", r[0], r[1])
+		}
+	}
+}
+
+func TestReuseOrder(t *testing.T) {
+	a := newTestAllocator(t, 1000, 1002)
+	l0 := mustAllocate(t, a)
+	l1 := mustAllocate(t, a)
+	if !a.Release(l0) || !a.Release(l1) {
+		t.Fatal("Release of current leases failed")
+	}
+
+	// Never-used ports come before released ones, then the oldest
+	// released port is reused first.
+	var got []int
+	for range 3 {
+		got = append(got, mustAllocate(t, a).Port)
+	}
+	if want := []int{1002, 1000, 1001}; !reflect.DeepEqual(got, want) {
+		t.Errorf("allocation order = %v; want %v", got, want)
+	}
+}
+
+func TestExhaustion(t *testing.T) {
+	a := newTestAllocator(t, 1000, 1001)
+	mustAllocate(t, a)
+	l := mustAllocate(t, a)
+	if _, err := a.Allocate(); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("Allocate on a full range = %v; want ErrExhausted", err)
+	}
+	a.Release(l)
+	if got := mustAllocate(t, a).Port; got != l.Port {
+		t.Errorf("Allocate after Release = %d; want %d", got, l.Port)
+	}
+}
+
+func TestStaleRelease(t *testing.T) {
+	a := newTestAllocator(t, 1000, 1000)
+	old := mustAllocate(t, a)
+	if !a.Release(old) {
+		t.Fatal("first Release failed")
+	}
+	if a.Release(old) {
+		t.Error("second Release of the same lease succeeded")
+	}
+
+	cur := mustAllocate(t, a)
+	if cur.Port != old.Port {
+		t.Fatalf("reallocated port = %d; want %d", cur.Port, old.Port)
+	}
+	if a.Release(old) {
+		t.Error("stale lease released a port owned by a newer lease")
+	}
+	if !a.InUse(cur.Port) || a.Len() != 1 {
+		t.Error("stale Release freed the current lease")
+	}
+	if !a.Release(cur) {
+		t.Error("Release of the current lease failed")
+	}
+}
+
+func TestOnRelease(t *testing.T) {
+	a := newTestAllocator(t, 1000, 1001)
+	var released []int
+	a.OnRelease = func(port int) {
+		// Called outside the lock, so the allocator is usable here.
+		if a.InUse(port) {
+			t.Errorf("port %d still in use in OnRelease", port)
+		}
+		released = append(released, port)
+	}
+	l := mustAllocate(t, a)
+	a.Release(l)
+	a.Release(l)
+	if want := []int{1000}; !reflect.DeepEqual(released, want) {
+		t.Errorf("OnRelease calls = %v; want %v", released, want)
+	}
+}
+
+func TestExhaustedError(t *testing.T) {
+	a := newTestAllocator(t, 1000, 1000)
+	mustAllocate(t, a)
+
+	_, err := a.Allocate()
+	var ee *ExhaustedError
+	if !errors.As(err, &ee) || ee.RetryAfter != DefaultRetryAfter {
+		t.Fatalf("Allocate = %v; want *ExhaustedError with RetryAfter %v", err, DefaultRetryAfter)
+	}
+	if !errors.Is(err, ErrExhausted) {
+		t.Error("ExhaustedError does not match ErrExhausted")
+	}
+
+	a.RetryAfter = 5 * time.Second
+	_, err = a.Allocate()
+	if !errors.As(err, &ee) || ee.RetryAfter != 5*time.Second {
+		t.Errorf("Allocate = %v; want RetryAfter 5s", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	a := newTestAllocator(t, 1000, 1001)
+	want := Stats{Size: 2}
+	if got := a.Stats(); got != want {
+		t.Errorf("Stats() = %+v; want %+v", got, want)
+	}
+	l := mustAllocate(t, a)
+	mustAllocate(t, a)
+	for range 3 {
+		a.Allocate()
+	}
+	want = Stats{Size: 2, InUse: 2, Exhausted: 3}
+	if got := a.Stats(); got != want {
+		t.Errorf("Stats() = %+v; want %+v", got, want)
+	}
+	a.Release(l)
+	want = Stats{Size: 2, InUse: 1, Exhausted: 3}
+	if got := a.Stats(); got != want {
+		t.Errorf("Stats() after Release = %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrAmbiguousFraming is returned by ValidateFraming for requests whose body
+// length could be read differently by the edge and the local service.
+var ErrAmbiguousFraming = errors.New("proxy: ambiguous request framing")
+
+// ValidateFraming rejects requests whose message framing is ambiguous, so
+// the edge cannot be used to smuggle a second request to a local service
+// that parses Content-Length and Transfer-Encoding differently.
+//
+// Request.Write frames the body from r.TransferEncoding and r.ContentLength
+// and ignores the Content-Length and Transfer-Encoding headers, so those
+// fields are what is checked. It refuses any transfer coding other than a
+// single chunked, chunked with a declared length, Transfer-Encoding on
+// HTTP/1.0, and a declared length with no body to send. A body shorter or
+// longer than ContentLength makes Request.Write fail part-way, so the
+// forwarder must drop the stream on a write error.
+//
+// NormalizeRequest calls ValidateFraming before it touches any headers, so
+// the check holds whatever order middlewares run in.
+//
+// Validation only covers bytes that go through Request.Write. Once a
+// visitor connection is hijacked, anything it sends is relayed as-is, so
+// only protocol upgrades should keep streaming raw bytes.
+func ValidateFraming(r *http.Request) error {
+	te := r.TransferEncoding
+	switch {
+	case len(te) > 0 && !r.ProtoAtLeast(1, 1):
+		return ErrAmbiguousFraming
+	case len(te) > 1:
+		return ErrAmbiguousFraming
+	case len(te) == 1 && (te[0] != "chunked" || r.ContentLength > 0):
+		return ErrAmbiguousFraming
+	case r.ContentLength < -1:
+		return ErrAmbiguousFraming
+	case r.ContentLength > 0 && (r.Body == nil || r.Body == http.NoBody):
+		return ErrAmbiguousFraming
+	}
+	return nil
+}
+
+// Framing is a middleware that answers requests failing ValidateFraming
+// with 400 and closes the connection. Normalize performs the same check;
+// Framing is for chains that forward without normalizing.
+func Framing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := ValidateFraming(r); err != nil {
+			rejectFraming(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rejectFraming(w http.ResponseWriter) {
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+}
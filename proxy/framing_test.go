@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// framingRequest builds a request as a middleware might leave it: the
+// framing fields and the matching headers set by hand.
+func framingRequest(proto string, te []string, length int64, body io.Reader) *http.Request {
+	r := httptest.NewRequest("POST", "/hook", body)
+	r.Proto = proto
+	r.ProtoMajor, r.ProtoMinor, _ = http.ParseHTTPVersion(proto)
+	r.TransferEncoding = te
+	if len(te) > 0 {
+		r.Header.Set("Transfer-Encoding", strings.Join(te, ", "))
+	}
+	r.ContentLength = length
+	if body == nil {
+		r.Body = http.NoBody
+	}
+	return r
+}
+
+func TestValidateFraming(t *testing.T) {
+	body := func() io.Reader { return strings.NewReader("hello") }
+	tests := []struct {
+		name string
+		r    *http.Request
+		ok   bool
+	}{
+		{"no body", framingRequest("HTTP/1.1", nil, 0, nil), true},
+		{"content-length", framingRequest("HTTP/1.1", nil, 5, body()), true},
+		{"unknown length", framingRequest("HTTP/1.1", nil, -1, body()), true},
+		{"chunked", framingRequest("HTTP/1.1", []string{"chunked"}, -1, body()), true},
+		{"gzip, chunked", framingRequest("HTTP/1.1", []string{"gzip", "chunked"}, -1, body()), false},
+		{"gzip", framingRequest("HTTP/1.1", []string{"gzip"}, -1, body()), false},
+		{"chunked with length", framingRequest("HTTP/1.1", []string{"chunked"}, 5, body()), false},
+		{"chunked on HTTP/1.0", framingRequest("HTTP/1.0", []string{"chunked"}, -1, body()), false},
+		{"length without body", framingRequest("HTTP/1.1", nil, 5, nil), false},
+		{"invalid length", framingRequest("HTTP/1.1", nil, -2, body()), false},
+	}
+	for _, tt := range tests {
+		err := ValidateFraming(tt.r)
+		if tt.ok && err != nil {
+			t.Errorf("%s: ValidateFraming = %v; want nil", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrAmbiguousFraming) {
+			t.Errorf("%s: ValidateFraming = %v; want ErrAmbiguousFraming", tt.name, err)
+		}
+	}
+}
+
+func TestValidateFramingParsed(t *testing.T) {
+	for _, raw := range []string{
+		"GET / HTTP/1.1\r\nHost: a\r\n\r\n",
+		"POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello",
+		"POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+		"POST / HTTP/1.0\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello",
+	} {
+		r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err != nil {
+			t.Fatalf("ReadRequest(%q): %v", raw, err)
+		}
+		if err := ValidateFraming(r); err != nil {
+			t.Errorf("ValidateFraming(%q) = %v; want nil", raw, err)
+		}
+	}
+}
+
+func TestNormalizeRequestValidatesFraming(t *testing.T) {
+	r := framingRequest("HTTP/1.1", []string{"gzip", "chunked"}, -1, strings.NewReader("x"))
+	r.Header.Set("Connection", "keep-alive")
+	if err := NormalizeRequest(r); !errors.Is(err, ErrAmbiguousFraming) {
+		t.Fatalf("NormalizeRequest = %v; want ErrAmbiguousFraming", err)
+	}
+	if r.Header.Get("Connection") == "" {
+		t.Error("NormalizeRequest modified a request it rejected")
+	}
+
+	// Stripping the Transfer-Encoding header must not hide the framing
+	// from a later check.
+	r = framingRequest("HTTP/1.1", []string{"gzip", "chunked"}, -1, strings.NewReader("x"))
+	RemoveHopHeaders(r.Header)
+	if err := ValidateFraming(r); !errors.Is(err, ErrAmbiguousFraming) {
+		t.Errorf("ValidateFraming after header removal = %v; want ErrAmbiguousFraming", err)
+	}
+}
+
+func TestFramingMiddlewareOrder(t *testing.T) {
+	chains := map[string]Chain{
+		"normalize":         {Normalize},
+		"framing":           {Framing},
+		"normalize,framing": {Normalize, Framing},
+		"framing,normalize": {Framing, Normalize},
+	}
+	for name, c := range chains {
+		reached := false
+		h := c.Then(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { reached = true }))
+		r := framingRequest("HTTP/1.1", []string{"gzip", "chunked"}, -1, strings.NewReader("x"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if reached || w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, handler reached %v; want 400 and not reached", name, w.Code, reached)
+		}
+		if got := w.Header().Get("Connection"); got != "close" {
+			t.Errorf("%s: Connection = %q; want close", name, got)
+		}
+	}
+}
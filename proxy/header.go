@@ -0,0 +1,96 @@
+// Package proxy holds the request handling shared by the edge proxy path:
+// header normalization and validation applied before a visitor request is
+// written to a tunnel stream.
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopHeaders are the hop-by-hop headers defined by RFC 9110, section 7.6.1,
+// plus the non-standard ones still sent by some proxies.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopHeaders deletes hop-by-hop headers from h, including any header
+// named in a Connection header.
+func RemoveHopHeaders(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// NormalizeRequest prepares r for forwarding to a local service. It first
+// validates the body framing with ValidateFraming and returns its error
+// without touching r. It then strips hop-by-hop headers while keeping the
+// ones needed for a protocol upgrade (such as WebSocket) and for
+// "TE: trailers", which gRPC relies on.
+func NormalizeRequest(r *http.Request) error {
+	if err := ValidateFraming(r); err != nil {
+		return err
+	}
+	upgrade := upgradeType(r.Header)
+	trailers := hasToken(r.Header["Te"], "trailers")
+
+	RemoveHopHeaders(r.Header)
+
+	if upgrade != "" {
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", upgrade)
+	}
+	if trailers {
+		r.Header.Set("Te", "trailers")
+	}
+	return nil
+}
+
+// NormalizeResponse strips hop-by-hop headers from a response read from a
+// tunnel stream, preserving an accepted protocol upgrade.
+func NormalizeResponse(resp *http.Response) {
+	upgrade := ""
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		upgrade = upgradeType(resp.Header)
+	}
+	RemoveHopHeaders(resp.Header)
+	if upgrade != "" {
+		resp.Header.Set("Connection", "Upgrade")
+		resp.Header.Set("Upgrade", upgrade)
+	}
+}
+
+func upgradeType(h http.Header) string {
+	if !hasToken(h["Connection"], "Upgrade") {
+		return ""
+	}
+	return h.Get("Upgrade")
+}
+
+// hasToken reports whether any of the comma-separated values contains
+// token, compared case-insensitively.
+func hasToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
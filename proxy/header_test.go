@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func mustNormalize(t *testing.T, r *http.Request) {
+	t.Helper()
+	if err := NormalizeRequest(r); err != nil {
+		t.Fatalf("NormalizeRequest: %v", err)
+	}
+}
+
+func TestRemoveHopHeaders(t *testing.T) {
+	h := http.Header{
+		"Connection":          {"keep-alive, X-Private", "x-other"},
+		"Keep-Alive":          {"timeout=5"},
+		"Proxy-Connection":    {"keep-alive"},
+		"Proxy-Authorization": {"Basic Zm9vOmJhcg=="},
+		"Te":                  {"gzip"},
+		"Upgrade":             {"h2c"},
+		"X-Private":           {"1"},
+		"X-Other":             {"2"},
+		"X-Kept":              {"3"},
+	}
+	RemoveHopHeaders(h)
+	want := http.Header{"X-Kept": {"3"}}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("RemoveHopHeaders left %v; want %v", h, want)
+	}
+}
+
+func TestNormalizeRequestUpgrade(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	mustNormalize(t, r)
+
+	if got := r.Header.Get("Connection"); got != "Upgrade" {
+		t.Errorf("Connection = %q; want Upgrade", got)
+	}
+	if got := r.Header.Get("Upgrade"); got != "websocket" {
+		t.Errorf("Upgrade = %q; want websocket", got)
+	}
+	if _, ok := r.Header["Keep-Alive"]; ok {
+		t.Error("Keep-Alive was not removed")
+	}
+	if r.Header.Get("Sec-WebSocket-Key") == "" {
+		t.Error("Sec-WebSocket-Key was removed")
+	}
+}
+
+func TestNormalizeRequestUpgradeWithoutConnection(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Upgrade", "websocket")
+	mustNormalize(t, r)
+	if _, ok := r.Header["Upgrade"]; ok {
+		t.Error("Upgrade not named in Connection must be removed")
+	}
+}
+
+func TestNormalizeRequestTrailers(t *testing.T) {
+	r := httptest.NewRequest("POST", "/svc.Method", nil)
+	r.Header.Set("Te", "gzip, Trailers")
+	mustNormalize(t, r)
+	if got := r.Header.Values("Te"); !reflect.DeepEqual(got, []string{"trailers"}) {
+		t.Errorf("Te = %q; want [trailers]", got)
+	}
+
+	r = httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Te", "gzip")
+	mustNormalize(t, r)
+	if _, ok := r.Header["Te"]; ok {
+		t.Error("Te without trailers was not removed")
+	}
+}
+
+func TestNormalizeResponseUpgrade(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusSwitchingProtocols,
+		Header: http.Header{
+			"Connection": {"Upgrade"},
+			"Upgrade":    {"websocket"},
+			"Keep-Alive": {"timeout=5"},
+		},
+	}
+	NormalizeResponse(resp)
+	want := http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}}
+	if !reflect.DeepEqual(resp.Header, want) {
+		t.Errorf("101 headers = %v; want %v", resp.Header, want)
+	}
+
+	resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}},
+	}
+	NormalizeResponse(resp)
+	if len(resp.Header) != 0 {
+		t.Errorf("200 headers = %v; want none", resp.Header)
+	}
+}
+
+func TestNormalizeRequestKeepsConditionalHeaders(t *testing.T) {
+	r := httptest.NewRequest("GET", "/big.iso", nil)
+	kept := http.Header{
+		"Range":               {"bytes=1048576-"},
+		"If-Range":            {`"v2"`},
+		"If-None-Match":       {`"v1", W/"v2"`},
+		"If-Match":            {`"v2"`},
+		"If-Modified-Since":   {"Wed, 21 Oct 2015 07:28:00 GMT"},
+		"If-Unmodified-Since": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+	}
+	for k, v := range kept {
+		r.Header[k] = v
+	}
+	r.Header.Set("Connection", "keep-alive")
+	mustNormalize(t, r)
+	if !reflect.DeepEqual(r.Header, kept) {
+		t.Errorf("headers after NormalizeRequest = %v; want %v", r.Header, kept)
+	}
+}
+
+func TestNormalizeResponseKeepsPartialAndNotModified(t *testing.T) {
+	for _, tt := range []struct {
+		code   int
+		header http.Header
+	}{
+		{http.StatusPartialContent, http.Header{
+			"Content-Range":  {"bytes 1048576-2097151/4194304"},
+			"Content-Length": {"1048576"},
+			"Accept-Ranges":  {"bytes"},
+			"Etag":           {`"v2"`},
+		}},
+		{http.StatusNotModified, http.Header{
+			"Etag":          {`"v2"`},
+			"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+			"Cache-Control": {"max-age=60"},
+		}},
+	} {
+		resp := &http.Response{StatusCode: tt.code, Header: http.Header{"Keep-Alive": {"timeout=5"}}}
+		for k, v := range tt.header {
+			resp.Header[k] = v
+		}
+		NormalizeResponse(resp)
+		if !reflect.DeepEqual(resp.Header, tt.header) {
+			t.Errorf("%d headers = %v; want %v", tt.code, resp.Header, tt.header)
+		}
+	}
+}
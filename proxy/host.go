@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/nexo-tech/localhost-tunneling/routing"
+)
+
+// Errors returned by Route. All of them should be answered with 400 Bad
+// Request, except ErrUnknownHost which maps to 404.
+var (
+	ErrAbsoluteURI = errors.New("proxy: absolute-form request target")
+	ErrMissingHost = errors.New("proxy: missing Host")
+	ErrSNIMismatch = errors.New("proxy: Host does not match TLS server name")
+	ErrUnknownHost = errors.New("proxy: no tunnel for host")
+)
+
+// Route validates the Host of a visitor request and resolves it in t.
+//
+// The edge is not a forward proxy, so absolute-form targets are rejected
+// rather than letting the URL authority and the Host header disagree over
+// which tunnel is meant. Over TLS the Host must name the same server as the
+// SNI, which keeps a request from being routed to one tunnel on the
+// strength of another tunnel's certificate. A lookup that yields no tunnel
+// name is treated as unknown. Duplicate Host headers are already rejected
+// by net/http before a handler runs.
+func Route(t *routing.Table, r *http.Request) (routing.Route, error) {
+	if r.URL.IsAbs() || r.URL.Host != "" {
+		return routing.Route{}, ErrAbsoluteURI
+	}
+	host := r.Host
+	if host == "" {
+		return routing.Route{}, ErrMissingHost
+	}
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		name := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			name = h
+		}
+		name = strings.TrimSuffix(name, ".")
+		if !strings.EqualFold(name, r.TLS.ServerName) {
+			return routing.Route{}, ErrSNIMismatch
+		}
+	}
+	route, ok := t.Lookup(host)
+	if !ok || route.Tunnel == "" {
+		return routing.Route{}, ErrUnknownHost
+	}
+	return route, nil
+}
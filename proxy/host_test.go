@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nexo-tech/localhost-tunneling/routing"
+)
+
+func newTestTable(t *testing.T) *routing.Table {
+	t.Helper()
+	var tb routing.Table
+	if err := tb.AddBase("tunnel.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	return &tb
+}
+
+func TestRoute(t *testing.T) {
+	tb := newTestTable(t)
+	tests := []struct {
+		name   string
+		method string
+		target string
+		host   string
+		sni    string
+		want   string
+		err    error
+	}{
+		{"origin-form", "GET", "/", "foo.tunnel.example.com", "", "foo", nil},
+		{"absolute-form", "GET", "http://foo.tunnel.example.com/", "foo.tunnel.example.com", "", "", ErrAbsoluteURI},
+		{"absolute-form other host", "GET", "http://bar.tunnel.example.com/", "foo.tunnel.example.com", "", "", ErrAbsoluteURI},
+		{"authority-form", "CONNECT", "foo.tunnel.example.com:443", "foo.tunnel.example.com:443", "", "", ErrAbsoluteURI},
+		{"missing host", "GET", "/", "", "", "", ErrMissingHost},
+		{"sni match", "GET", "/", "foo.tunnel.example.com", "foo.tunnel.example.com", "foo", nil},
+		{"sni match port and dot", "GET", "/", "FOO.tunnel.example.com.:443", "foo.tunnel.example.com", "foo", nil},
+		{"sni mismatch", "GET", "/", "bar.tunnel.example.com", "foo.tunnel.example.com", "", ErrSNIMismatch},
+		{"sni mismatch with port", "GET", "/", "bar.tunnel.example.com:443", "foo.tunnel.example.com", "", ErrSNIMismatch},
+		{"unknown host", "GET", "/", "foo.other.org", "", "", ErrUnknownHost},
+		{"empty label", "GET", "/", ".tunnel.example.com", "", "", ErrUnknownHost},
+		{"wildcard label", "GET", "/", "*.tunnel.example.com", "", "", ErrUnknownHost},
+		{"apex", "GET", "/", "tunnel.example.com", "", "", ErrUnknownHost},
+		{"non-LDH label", "GET", "/", "foo%2e.tunnel.example.com", "", "", ErrUnknownHost},
+		{"underscore label", "GET", "/", "foo_bar.tunnel.example.com", "", "", ErrUnknownHost},
+		{"non-numeric port", "GET", "/", "foo.tunnel.example.com:abc", "", "", ErrUnknownHost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Host = tt.host
+			if tt.sni != "" {
+				r.TLS = &tls.ConnectionState{ServerName: tt.sni}
+			}
+			route, err := Route(tb, r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Route error = %v; want %v", err, tt.err)
+			}
+			if route.Tunnel != tt.want {
+				t.Errorf("Route tunnel = %q; want %q", route.Tunnel, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouted(t *testing.T) {
+	tb := newTestTable(t)
+	h := Routed(tb)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := RouteFrom(r.Context())
+		if !ok {
+			t.Error("no route in request context")
+		}
+		w.Write([]byte(route.Tunnel))
+	}))
+	tests := []struct {
+		target string
+		host   string
+		code   int
+		body   string
+	}{
+		{"/", "foo.tunnel.example.com", http.StatusOK, "foo"},
+		{"/", "foo.other.org", http.StatusNotFound, ""},
+		{"/", ".tunnel.example.com", http.StatusNotFound, ""},
+		{"http://foo.tunnel.example.com/", "foo.tunnel.example.com", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: status = %d; want %d", tt.host, tt.target, w.Code, tt.code)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: body = %q; want %q", tt.host, w.Body.String(), tt.body)
+		}
+	}
+}
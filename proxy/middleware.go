@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nexo-tech/localhost-tunneling/routing"
+)
+
+// Middleware wraps an edge handler. Edge features such as auth, rate
+// limiting, header rewriting, capture and caching are written as
+// middlewares so each can be built and tested on its own.
+type Middleware func(http.Handler) http.Handler
+
+// Chain is an ordered list of middlewares. The first one sees the request
+// first.
+type Chain []Middleware
+
+// Then wraps h in the chain.
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// Resolve builds a chain from middleware names in order, looking each up
+// in available. It is how per-tunnel ordering from configuration becomes a
+// Chain.
+func Resolve(names []string, available map[string]Middleware) (Chain, error) {
+	c := make(Chain, 0, len(names))
+	for _, name := range names {
+		m, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("proxy: unknown middleware %q", name)
+		}
+		c = append(c, m)
+	}
+	return c, nil
+}
+
+// Normalize is a middleware that applies NormalizeRequest, answering
+// requests with ambiguous framing like Framing does.
+func Normalize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := NormalizeRequest(r); err != nil {
+			rejectFraming(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type routeKey struct{}
+
+// Routed returns a middleware that resolves the request with Route, stores
+// the result for RouteFrom and rejects requests that cannot be routed.
+func Routed(t *routing.Table) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, err := Route(t, r)
+			if err != nil {
+				code := http.StatusBadRequest
+				if errors.Is(err, ErrUnknownHost) {
+					code = http.StatusNotFound
+				}
+				http.Error(w, http.StatusText(code), code)
+				return
+			}
+			ctx := context.WithValue(r.Context(), routeKey{}, route)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RouteFrom returns the route stored by Routed.
+func RouteFrom(ctx context.Context) (routing.Route, bool) {
+	route, ok := ctx.Value(routeKey{}).(routing.Route)
+	return route, ok
+}
@@ -0,0 +1,110 @@
+// Package registry tracks which client session currently serves each tunnel
+// name.
+//
+// A name is owned by an owner ID, which stays stable across reconnects (for
+// example a resumption token). When the owner reconnects, the new session
+// atomically takes over the name. A different owner cannot claim a name
+// while it is held. Releasing a name only works for the session that
+// currently holds it, so a stale session's teardown doesn't remove the
+// session that replaced it.
+package registry
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTaken is returned by Claim when name is held by a different owner.
+var ErrTaken = errors.New("registry: name is owned by another client")
+
+// ErrEmpty is returned by Claim for an empty name or owner.
+var ErrEmpty = errors.New("registry: empty name or owner")
+
+type entry[S comparable] struct {
+	owner   string
+	session S
+}
+
+// Registry maps tunnel names to sessions of type S. The zero value is empty
+// and ready to use; a Registry is safe for concurrent use.
+type Registry[S comparable] struct {
+	mu      sync.RWMutex
+	entries map[string]entry[S]
+}
+
+// Claim gives name to session on behalf of owner. If owner already holds
+// name, the old session is replaced and returned with replaced set, and the
+// caller is responsible for closing it. Re-claiming with the session that
+// already holds name is a no-op and does not report a replacement, so a
+// retried claim never asks the caller to close its own live session. If
+// another owner holds name, Claim returns ErrTaken; an empty name or owner
+// returns ErrEmpty.
+func (r *Registry[S]) Claim(name, owner string, session S) (prev S, replaced bool, err error) {
+	if name == "" || owner == "" {
+		return prev, false, ErrEmpty
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[name]; ok {
+		if e.owner != owner {
+			return prev, false, ErrTaken
+		}
+		if e.session == session {
+			return prev, false, nil
+		}
+		prev, replaced = e.session, true
+	}
+	if r.entries == nil {
+		r.entries = make(map[string]entry[S])
+	}
+	r.entries[name] = entry[S]{owner: owner, session: session}
+	return prev, replaced, nil
+}
+
+// Release removes name if it is still held by session and reports whether
+// it did.
+func (r *Registry[S]) Release(name string, session S) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.entries[name]; ok && e.session == session {
+		delete(r.entries, name)
+		return true
+	}
+	return false
+}
+
+// Lookup returns the session serving name.
+func (r *Registry[S]) Lookup(name string) (S, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[name]
+	return e.session, ok
+}
+
+// Owner returns the owner ID holding name.
+func (r *Registry[S]) Owner(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[name]
+	return e.owner, ok
+}
+
+// Len returns the number of registered names.
+func (r *Registry[S]) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.entries)
+}
+
+// Range calls f for each registered name until f returns false. The
+// registry is read-locked for the duration, so f must not call back into
+// it.
+func (r *Registry[S]) Range(f func(name string, session S) bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, e := range r.entries {
+		if !f(name, e.session) {
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type session struct{ id int }
+
+func TestClaimSameOwnerReplaces(t *testing.T) {
+	var r Registry[*session]
+	s1, s2 := &session{1}, &session{2}
+
+	prev, replaced, err := r.Claim("foo", "owner-a", s1)
+	if err != nil || replaced || prev != nil {
+		t.Fatalf("first Claim = %v, %v, %v; want nil, false, nil", prev, replaced, err)
+	}
+	prev, replaced, err = r.Claim("foo", "owner-a", s2)
+	if err != nil || !replaced || prev != s1 {
+		t.Fatalf("reconnect Claim = %v, %v, %v; want s1, true, nil", prev, replaced, err)
+	}
+	if got, ok := r.Lookup("foo"); !ok || got != s2 {
+		t.Errorf("Lookup after reconnect = %v, %v; want s2", got, ok)
+	}
+	if r.Len() != 1 {
+		t.Errorf("Len = %d; want 1", r.Len())
+	}
+}
+
+func TestClaimSameSessionIsNoop(t *testing.T) {
+	var r Registry[*session]
+	s1 := &session{1}
+	r.Claim("foo", "owner-a", s1)
+	prev, replaced, err := r.Claim("foo", "owner-a", s1)
+	if err != nil || replaced || prev != nil {
+		t.Fatalf("repeated Claim = %v, %v, %v; want nil, false, nil", prev, replaced, err)
+	}
+	if got, ok := r.Lookup("foo"); !ok || got != s1 {
+		t.Errorf("Lookup after repeated Claim = %v, %v; want s1", got, ok)
+	}
+}
+
+func TestClaimEmpty(t *testing.T) {
+	var r Registry[*session]
+	for _, c := range [][2]string{{"", "owner-a"}, {"foo", ""}, {"", ""}} {
+		if _, _, err := r.Claim(c[0], c[1], &session{1}); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Claim(%q, %q) = %v; want ErrEmpty", c[0], c[1], err)
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("Len = %d after rejected claims; want 0", r.Len())
+	}
+}
+
+func TestClaimOtherOwnerTaken(t *testing.T) {
+	var r Registry[*session]
+	s1 := &session{1}
+	if _, _, err := r.Claim("foo", "owner-a", s1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Claim("foo", "owner-b", &session{2}); !errors.Is(err, ErrTaken) {
+		t.Fatalf("Claim by another owner = %v; want ErrTaken", err)
+	}
+	if got, _ := r.Lookup("foo"); got != s1 {
+		t.Errorf("Lookup = %v; the failed Claim must not change the session", got)
+	}
+	if owner, _ := r.Owner("foo"); owner != "owner-a" {
+		t.Errorf("Owner = %q; want owner-a", owner)
+	}
+}
+
+func TestReleaseStaleSession(t *testing.T) {
+	var r Registry[*session]
+	old, cur := &session{1}, &session{2}
+	r.Claim("foo", "owner-a", old)
+	r.Claim("foo", "owner-a", cur)
+
+	if r.Release("foo", old) {
+		t.Error("Release by the replaced session succeeded")
+	}
+	if got, ok := r.Lookup("foo"); !ok || got != cur {
+		t.Errorf("Lookup after stale Release = %v, %v; want current session", got, ok)
+	}
+	if !r.Release("foo", cur) {
+		t.Error("Release by the current session failed")
+	}
+	if _, ok := r.Lookup("foo"); ok {
+		t.Error("name still registered after Release")
+	}
+	if _, _, err := r.Claim("foo", "owner-b", &session{3}); err != nil {
+		t.Errorf("Claim of a released name by another owner = %v", err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	var r Registry[*session]
+	for i := range 3 {
+		r.Claim(fmt.Sprint("t", i), "o", &session{i})
+	}
+	n := 0
+	r.Range(func(string, *session) bool { n++; return true })
+	if n != 3 {
+		t.Errorf("Range visited %d names; want 3", n)
+	}
+	n = 0
+	r.Range(func(string, *session) bool { n++; return false })
+	if n != 1 {
+		t.Errorf("Range visited %d names after returning false; want 1", n)
+	}
+}
+
+// TestConcurrent is meant to be run with -race.
+func TestConcurrent(t *testing.T) {
+	var r Registry[*session]
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			owner := fmt.Sprint("owner-", w%2)
+			for i := range 500 {
+				name := fmt.Sprint("t", i%10)
+				s := &session{i}
+				if _, _, err := r.Claim(name, owner, s); err != nil && !errors.Is(err, ErrTaken) {
+					t.Errorf("Claim: %v", err)
+					return
+				}
+				r.Lookup(name)
+				r.Owner(name)
+				r.Len()
+				r.Range(func(string, *session) bool { return true })
+				r.Release(name, s)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,318 @@
+// Package routing resolves the Host of a public request to the tunnel that
+// should serve it.
+//
+// A Table holds three kinds of entries:
+//
+//   - base domains, under which every single-label subdomain is a tunnel
+//     name (foo.tunnel.example.com routes to tunnel "foo");
+//   - exact custom domains bound to a tunnel (app.customer.com);
+//   - wildcard custom domains bound to a tunnel (*.customer.com).
+//
+// Hosts are matched case-insensitively with any port and trailing dot
+// removed. Exact bindings win; otherwise the longest matching suffix among
+// base domains and wildcards is used. Like wildcard certificates, both base
+// domains and wildcards cover exactly one label: a.b.customer.com matches
+// neither *.customer.com nor a base domain customer.com.
+//
+// Custom domains cannot be bound at or under a base domain, so a binding
+// can never take over a name that belongs to a subdomain tunnel or to the
+// server itself.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Kind describes which kind of entry produced a Route.
+type Kind int
+
+const (
+	// Subdomain is a single label under a base domain.
+	Subdomain Kind = iota
+	// Exact is a custom domain bound to a tunnel.
+	Exact
+	// Wildcard is a wildcard custom domain bound to a tunnel.
+	Wildcard
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Subdomain:
+		return "subdomain"
+	case Exact:
+		return "exact"
+	case Wildcard:
+		return "wildcard"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Route is the result of a successful Lookup.
+type Route struct {
+	Tunnel string // tunnel name
+	Domain string // base domain or bound pattern that matched
+	Kind   Kind
+}
+
+// ErrConflict is returned when an entry would shadow an existing one for
+// the same domain.
+var ErrConflict = errors.New("routing: domain already in use")
+
+// Table is a host routing table. The zero value is empty and ready to use;
+// a Table is safe for concurrent use.
+type Table struct {
+	mu        sync.RWMutex
+	bases     map[string]struct{}
+	exact     map[string]string // host -> tunnel
+	wildcards map[string]string // suffix of "*.suffix" -> tunnel
+}
+
+// AddBase registers domain as a base domain.
+func (t *Table) AddBase(domain string) error {
+	d, err := normalizeName(domain)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range []map[string]string{t.exact, t.wildcards} {
+		for name := range m {
+			if name == d || strings.HasSuffix(name, "."+d) {
+				return fmt.Errorf("%w: %s", ErrConflict, d)
+			}
+		}
+	}
+	if t.bases == nil {
+		t.bases = make(map[string]struct{})
+	}
+	t.bases[d] = struct{}{}
+	return nil
+}
+
+// RemoveBase unregisters a base domain. Bindings are not affected.
+func (t *Table) RemoveBase(domain string) {
+	d, err := normalizeName(domain)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.bases, d)
+	t.mu.Unlock()
+}
+
+// HasBase reports whether domain is a registered base domain. It is meant
+// for validating a base domain requested by a client at registration.
+func (t *Table) HasBase(domain string) bool {
+	d, err := normalizeName(domain)
+	if err != nil {
+		return false
+	}
+	t.mu.RLock()
+	_, ok := t.bases[d]
+	t.mu.RUnlock()
+	return ok
+}
+
+// Bases returns the registered base domains in no particular order.
+func (t *Table) Bases() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]string, 0, len(t.bases))
+	for d := range t.bases {
+		out = append(out, d)
+	}
+	return out
+}
+
+// Bind routes pattern to tunnel. The pattern is either an exact host name
+// or a wildcard of the form "*.example.com". Rebinding a pattern to the
+// same tunnel is a no-op; binding it to a different tunnel, or binding at
+// or under a base domain, is a conflict.
+func (t *Table) Bind(pattern, tunnel string) error {
+	if tunnel == "" {
+		return errors.New("routing: empty tunnel name")
+	}
+	name, wild, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.underBase(name) {
+		return fmt.Errorf("%w: %s", ErrConflict, pattern)
+	}
+	m := &t.exact
+	if wild {
+		m = &t.wildcards
+	}
+	if cur, ok := (*m)[name]; ok && cur != tunnel {
+		return fmt.Errorf("%w: %s is bound to %q", ErrConflict, pattern, cur)
+	}
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[name] = tunnel
+	return nil
+}
+
+// underBase reports whether name is a base domain or a name under one. The
+// caller must hold t.mu.
+func (t *Table) underBase(name string) bool {
+	for {
+		if _, ok := t.bases[name]; ok {
+			return true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+}
+
+// Unbind removes the binding for pattern, if any.
+func (t *Table) Unbind(pattern string) {
+	name, wild, err := parsePattern(pattern)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	if wild {
+		delete(t.wildcards, name)
+	} else {
+		delete(t.exact, name)
+	}
+	t.mu.Unlock()
+}
+
+// UnbindTunnel removes every binding that points at tunnel.
+func (t *Table) UnbindTunnel(tunnel string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, v := range t.exact {
+		if v == tunnel {
+			delete(t.exact, k)
+		}
+	}
+	for k, v := range t.wildcards {
+		if v == tunnel {
+			delete(t.wildcards, k)
+		}
+	}
+}
+
+// Lookup resolves host, which may carry a port, to a route.
+func (t *Table) Lookup(host string) (Route, bool) {
+	h := normalizeHost(host)
+	if h == "" {
+		return Route{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if tun, ok := t.exact[h]; ok {
+		return Route{Tunnel: tun, Domain: h, Kind: Exact}, true
+	}
+	if _, ok := t.bases[h]; ok {
+		// The apex of a base domain belongs to the server, not a tunnel.
+		return Route{}, false
+	}
+	// Walk suffixes from longest to shortest; the first hit wins.
+	full := h
+	for i := strings.IndexByte(h, '.'); i >= 0; i = strings.IndexByte(h, '.') {
+		suffix := h[i+1:]
+		name := full[:len(full)-len(suffix)-1]
+		single := name != "" && !strings.Contains(name, ".")
+		if tun, ok := t.wildcards[suffix]; ok && single {
+			return Route{Tunnel: tun, Domain: "*." + suffix, Kind: Wildcard}, true
+		}
+		if _, ok := t.bases[suffix]; ok {
+			if !single {
+				// Nested names under a base domain are not tunnels.
+				return Route{}, false
+			}
+			return Route{Tunnel: name, Domain: suffix, Kind: Subdomain}, true
+		}
+		h = suffix
+	}
+	return Route{}, false
+}
+
+// normalizeHost lowercases host and strips any port and trailing dot. It
+// returns "" for hosts that cannot be routed: ones that are not valid
+// host names (see normalizeName) or carry a non-numeric port.
+func normalizeHost(host string) string {
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if !validPort(port) {
+			return ""
+		}
+		host = h
+	}
+	n, err := normalizeName(host)
+	if err != nil {
+		return ""
+	}
+	return n
+}
+
+// normalizeName lowercases name and strips a trailing dot. The name must be
+// an ASCII host name: labels of letters, digits and '-', not starting or
+// ending with '-', at most 63 bytes each and 253 in total.
+func normalizeName(name string) (string, error) {
+	n := strings.TrimSuffix(name, ".")
+	if n == "" {
+		return "", errors.New("routing: empty domain")
+	}
+	if len(n) > 253 {
+		return "", fmt.Errorf("routing: invalid domain %q", name)
+	}
+	for _, l := range strings.Split(n, ".") {
+		if !validLabel(l) {
+			return "", fmt.Errorf("routing: invalid domain %q", name)
+		}
+	}
+	// Only ASCII is left, so ToLower cannot fold anything into it.
+	return strings.ToLower(n), nil
+}
+
+func validLabel(l string) bool {
+	if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(l); i++ {
+		c := l[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func validPort(port string) bool {
+	if port == "" || len(port) > 5 {
+		return false
+	}
+	n := 0
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return false
+		}
+		n = n*10 + int(port[i]-'0')
+	}
+	return n <= 65535
+}
+
+func parsePattern(pattern string) (name string, wild bool, err error) {
+	if rest, ok := strings.CutPrefix(pattern, "*."); ok {
+		name, err = normalizeName(rest)
+		return name, true, err
+	}
+	name, err = normalizeName(pattern)
+	return name, false, err
+}
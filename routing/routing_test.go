@@ -0,0 +1,213 @@
+package routing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestTable(t *testing.T) *Table {
+	t.Helper()
+	var tb Table
+	for _, d := range []string{"tunnel.example.com", "Example.NET"} {
+		if err := tb.AddBase(d); err != nil {
+			t.Fatalf("AddBase(%q): %v", d, err)
+		}
+	}
+	binds := map[string]string{
+		"app.customer.com": "c1",
+		"*.customer.org":   "c2",
+		"*.example.com":    "wild",
+	}
+	for p, tun := range binds {
+		if err := tb.Bind(p, tun); err != nil {
+			t.Fatalf("Bind(%q, %q): %v", p, tun, err)
+		}
+	}
+	return &tb
+}
+
+func TestLookup(t *testing.T) {
+	tb := newTestTable(t)
+	tests := []struct {
+		host string
+		want Route
+		ok   bool
+	}{
+		{"FOO.Tunnel.Example.COM", Route{"foo", "tunnel.example.com", Subdomain}, true},
+		{"foo.tunnel.example.com:8443", Route{"foo", "tunnel.example.com", Subdomain}, true},
+		{"foo.tunnel.example.com.", Route{"foo", "tunnel.example.com", Subdomain}, true},
+		{"foo.tunnel.example.com.:443", Route{"foo", "tunnel.example.com", Subdomain}, true},
+		{"bar.example.net", Route{"bar", "example.net", Subdomain}, true},
+		{"app.customer.com", Route{"c1", "app.customer.com", Exact}, true},
+		{"APP.customer.com:80", Route{"c1", "app.customer.com", Exact}, true},
+		{"x.customer.org", Route{"c2", "*.customer.org", Wildcard}, true},
+
+		// *.example.com sits above the tunnel.example.com base: the longer
+		// base suffix wins under it, the wildcard covers its siblings.
+		{"foo.tunnel.example.com", Route{"foo", "tunnel.example.com", Subdomain}, true},
+		{"other.example.com", Route{"wild", "*.example.com", Wildcard}, true},
+
+		// Apexes belong to the server.
+		{"tunnel.example.com", Route{}, false},
+		{"example.net:443", Route{}, false},
+
+		// Nested names match neither bases nor wildcards.
+		{"a.b.tunnel.example.com", Route{}, false},
+		{"a.b.customer.org", Route{}, false},
+		{"customer.org", Route{}, false},
+
+		// Malformed hosts.
+		{"", Route{}, false},
+		{".tunnel.example.com", Route{}, false},
+		{"*.tunnel.example.com", Route{}, false},
+		{"foo..tunnel.example.com", Route{}, false},
+		{"foo.tunnel.example.com..", Route{}, false},
+		{"[::1]:80", Route{}, false},
+		{"foo/bar.tunnel.example.com", Route{}, false},
+		{"foo\x00.tunnel.example.com", Route{}, false},
+		{"foo\t.tunnel.example.com", Route{}, false},
+		{"foo%2e.tunnel.example.com", Route{}, false},
+		{"foo_bar.tunnel.example.com", Route{}, false},
+		{"foo~.tunnel.example.com", Route{}, false},
+		{"f\u00f6o.tunnel.example.com", Route{}, false},
+		{"\u212a.tunnel.example.com", Route{}, false}, // Kelvin sign lowercases to "k"
+		{"-.tunnel.example.com", Route{}, false},
+		{"-foo.tunnel.example.com", Route{}, false},
+		{"foo-.tunnel.example.com", Route{}, false},
+		{strings.Repeat("a", 64) + ".tunnel.example.com", Route{}, false},
+		{strings.Repeat("a.", 120) + "tunnel.example.com", Route{}, false},
+		{"foo.tunnel.example.com:abc", Route{}, false},
+		{"foo.tunnel.example.com:", Route{}, false},
+		{"foo.tunnel.example.com:99999", Route{}, false},
+		{"foo.tunnel.example.com:-1", Route{}, false},
+
+		// Valid LDH edge cases.
+		{"f-o-0.tunnel.example.com", Route{"f-o-0", "tunnel.example.com", Subdomain}, true},
+		{"9.tunnel.example.com", Route{"9", "tunnel.example.com", Subdomain}, true},
+		{strings.Repeat("a", 63) + ".tunnel.example.com", Route{strings.Repeat("a", 63), "tunnel.example.com", Subdomain}, true},
+		{"unknown.org", Route{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := tb.Lookup(tt.host)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%q) = %+v, %v; want %+v, %v", tt.host, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBindConflicts(t *testing.T) {
+	tests := []struct {
+		pattern string
+		tunnel  string
+		err     bool
+	}{
+		{"app.customer.com", "c1", false}, // same tunnel again
+		{"app.customer.com", "other", true},
+		{"*.customer.org", "other", true},
+		{"tunnel.example.com", "x", true},       // base apex
+		{"bob.tunnel.example.com", "x", true},   // subdomain tunnel name
+		{"a.bob.tunnel.example.com", "x", true}, // nested under a base
+		{"*.tunnel.example.com", "x", true},
+		{"*.bob.tunnel.example.com", "x", true},
+		{"*.example.net", "x", true},
+		{"new.customer.com", "c3", false},
+		{"", "x", true},
+		{"*.", "x", true},
+		{"a..b", "x", true},
+		{"ok.customer.com", "", true},
+		{"foo\x00.customer.com", "x", true},
+		{"foo%2e.customer.com", "x", true},
+		{"foo_bar.customer.com", "x", true},
+		{"-.customer.com", "x", true},
+		{"*.-x.shop.io", "x", true},
+		{"**.shop.io", "x", true},
+		{strings.Repeat("a", 64) + ".shop.io", "x", true},
+	}
+	for _, tt := range tests {
+		tb := newTestTable(t)
+		err := tb.Bind(tt.pattern, tt.tunnel)
+		if (err != nil) != tt.err {
+			t.Errorf("Bind(%q, %q) = %v; want error %v", tt.pattern, tt.tunnel, err, tt.err)
+		}
+	}
+}
+
+func TestAddBaseConflicts(t *testing.T) {
+	tests := []struct {
+		domain   string
+		err      bool
+		conflict bool
+	}{
+		{"customer.org", true, true}, // wildcard *.customer.org
+		{"customer.com", true, true}, // exact app.customer.com sits under it
+		{"app.customer.com", true, true},
+		{"example.com", true, true}, // *.example.com
+		{"dev.example.org", false, false},
+		{"tunnel.example.com", false, false}, // re-adding is fine
+		{"", true, false},
+		{"a..b", true, false},
+		{"bad_base.org", true, false},
+		{"-bad.org", true, false},
+	}
+	for _, tt := range tests {
+		tb := newTestTable(t)
+		err := tb.AddBase(tt.domain)
+		if (err != nil) != tt.err {
+			t.Errorf("AddBase(%q) = %v; want error %v", tt.domain, err, tt.err)
+		}
+		if errors.Is(err, ErrConflict) != tt.conflict {
+			t.Errorf("AddBase(%q) = %v; want ErrConflict %v", tt.domain, err, tt.conflict)
+		}
+	}
+}
+
+func TestUnbind(t *testing.T) {
+	tb := newTestTable(t)
+	tb.Unbind("APP.customer.com")
+	if _, ok := tb.Lookup("app.customer.com"); ok {
+		t.Error("app.customer.com still routes after Unbind")
+	}
+	tb.Unbind("*.customer.org")
+	if _, ok := tb.Lookup("x.customer.org"); ok {
+		t.Error("x.customer.org still routes after Unbind")
+	}
+	if err := tb.Bind("app.customer.com", "other"); err != nil {
+		t.Errorf("Bind after Unbind: %v", err)
+	}
+}
+
+func TestUnbindTunnel(t *testing.T) {
+	tb := newTestTable(t)
+	for _, p := range []string{"www.shop.io", "*.shop.io"} {
+		if err := tb.Bind(p, "c1"); err != nil {
+			t.Fatalf("Bind(%q): %v", p, err)
+		}
+	}
+	tb.UnbindTunnel("c1")
+	for _, h := range []string{"app.customer.com", "www.shop.io", "x.shop.io"} {
+		if _, ok := tb.Lookup(h); ok {
+			t.Errorf("%s still routes after UnbindTunnel", h)
+		}
+	}
+	if r, ok := tb.Lookup("x.customer.org"); !ok || r.Tunnel != "c2" {
+		t.Errorf("Lookup(x.customer.org) = %+v, %v; other tunnels must be kept", r, ok)
+	}
+}
+
+func TestBases(t *testing.T) {
+	tb := newTestTable(t)
+	if !tb.HasBase("EXAMPLE.net.") {
+		t.Error("HasBase(EXAMPLE.net.) = false")
+	}
+	if tb.HasBase("customer.com") {
+		t.Error("HasBase(customer.com) = true")
+	}
+	tb.RemoveBase("example.net")
+	if _, ok := tb.Lookup("bar.example.net"); ok {
+		t.Error("bar.example.net still routes after RemoveBase")
+	}
+	if got := tb.Bases(); len(got) != 1 || got[0] != "tunnel.example.com" {
+		t.Errorf("Bases() = %v", got)
+	}
+}